@@ -1,116 +1,131 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"math/rand"
+	"sync"
 
 	. "github.com/claudetech/loggo/default"
 )
 
-// Buffer buffers the stream and stores chunks
+// sequentialTrackLength is how many recent read offsets are kept to detect sequential access
+const sequentialTrackLength = 3
+
+// Buffer serves reads for a single open file handle, translating arbitrary FUSE
+// ranges into aligned chunk fetches against a ChunkManager
 type Buffer struct {
 	id     string
 	client *Drive
-	cache  *Cache
+	chunks *ChunkManager
 	object *APIObject
-	offset int64
-	stream io.ReadCloser
+
+	mu      sync.Mutex
+	offsets []int64
 }
 
 // NewBuffer creates a new buffer
-func NewBuffer(client *Drive, cache *Cache, object *APIObject) (*Buffer, error) {
+func NewBuffer(client *Drive, chunks *ChunkManager, object *APIObject) (*Buffer, error) {
 	id := fmt.Sprintf("%v:%v", object.ObjectID, rand.Int63n(9999))
 	return &Buffer{
 		id:     id,
 		client: client,
-		cache:  cache,
+		chunks: chunks,
 		object: object,
 	}, nil
 }
 
 // Close closes all open stream handlers
 func (b *Buffer) Close() error {
-	if nil != b.stream {
-		if err := b.stream.Close(); nil != err {
-			Log.Debugf("%v", err)
-			return fmt.Errorf("Could not close stream %v", b.id)
-		}
-	}
 	return nil
 }
 
-// Read reads the requested chunk
-func (b *Buffer) Read(offset, size int64) ([]byte, error) {
-	// disabled preload
-	// if uint64(offset+size) < b.object.Size {
-	// 	defer func() {
-	// 		go b.readBytes(offset+size, size)
-	// 	}()
-	// }
+// Read reads size bytes starting at offset, fetching and reassembling the underlying
+// aligned chunks as needed. It returns early with ctx.Err() if ctx is cancelled or its
+// deadline passes before the read completes, so a FUSE request abort or a slow Drive
+// response doesn't hang the caller. A read waiting on a chunk fetch that another caller
+// started waits for that fetch to finish before it sees its own ctx.
+func (b *Buffer) Read(ctx context.Context, offset, size int64) ([]byte, error) {
+	b.trackOffset(offset)
+
+	result := make([]byte, 0, size)
+	current := offset
+	remaining := size
+
+	for remaining > 0 {
+		if err := ctx.Err(); nil != err {
+			return nil, err
+		}
 
-	return b.readBytes(offset, size)
-}
+		index := b.chunks.chunkIndex(current)
+		chunkStart := b.chunks.chunkOffset(index)
 
-func (b *Buffer) readBytes(offset, size int64) ([]byte, error) {
-	id := fmt.Sprintf("%v:%v", b.object.ObjectID, offset)
+		chunk, err := b.chunks.GetChunk(ctx, b.object, index)
+		if nil != err {
+			if io.EOF == err && len(result) > 0 {
+				break
+			}
+			if ctxErr := ctx.Err(); nil != ctxErr {
+				return nil, ctxErr
+			}
+			Log.Debugf("%v", err)
+			return nil, fmt.Errorf("Could not read bytes at offset %v for stream %v", offset, b.id)
+		}
 
-	chunk, err := b.cache.LoadChunk(id)
-	if nil == err {
-		Log.Debugf("Found chunk %v in cache", id)
-		return chunk.Bytes, nil
-	}
+		inChunkOffset := current - chunkStart
+		if inChunkOffset >= int64(len(chunk)) {
+			break
+		}
 
-	Log.Debugf("Loading chunk %v from API", id)
-	bytes, err := b.readFromAPI(offset, size)
-	if nil != err {
-		return nil, err
-	}
+		end := inChunkOffset + remaining
+		if end > int64(len(chunk)) {
+			end = int64(len(chunk))
+		}
 
-	b.cache.StoreChunk(&Chunk{
-		ID:       id,
-		ObjectID: b.object.ObjectID,
-		Offset:   offset,
-		Size:     size,
-		Bytes:    bytes,
-	})
+		result = append(result, chunk[inChunkOffset:end]...)
+		consumed := end - inChunkOffset
+		current += consumed
+		remaining -= consumed
 
-	return bytes, nil
-}
+		if int64(len(chunk)) < b.chunks.chunkSize {
+			// last chunk of the object, nothing more to read
+			break
+		}
+	}
 
-func (b *Buffer) readFromAPI(offset, size int64) ([]byte, error) {
-	if uint64(offset) > b.object.Size {
-		return nil, io.EOF
+	if b.isSequential() {
+		nextIndex := b.chunks.chunkIndex(current)
+		go b.chunks.Prefetch(b.object, nextIndex, sequentialPrefetchChunks)
 	}
 
-	if b.shouldReopen(offset, size) {
-		if nil != b.stream {
-			if err := b.stream.Close(); nil != err {
-				Log.Warningf("Could not close old stream handler %v", b.id)
-			}
-		}
+	return result, nil
+}
 
-		Log.Debugf("Open new stream handler %v at offset %v", b.id, offset)
-		stream, err := b.client.Open(b.object, offset)
-		if nil != err {
-			Log.Debugf("%v", err)
-			return nil, fmt.Errorf("Could not open stream %v", b.id)
-		}
-		b.stream = stream
-		b.offset = offset
-	}
+// trackOffset records offset as the most recent read, keeping only the last
+// sequentialTrackLength entries
+func (b *Buffer) trackOffset(offset int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	buffer := make([]byte, size)
-	n, err := b.stream.Read(buffer)
-	if nil != err && io.EOF != err {
-		Log.Debugf("%v", err)
-		return nil, fmt.Errorf("Could not read bytes at offset %v for stream %v", offset, b.id)
+	b.offsets = append(b.offsets, offset)
+	if len(b.offsets) > sequentialTrackLength {
+		b.offsets = b.offsets[len(b.offsets)-sequentialTrackLength:]
 	}
-	b.offset += int64(n)
-
-	return buffer, nil
 }
 
-func (b *Buffer) shouldReopen(offset, size int64) bool {
-	return nil == b.stream || offset != b.offset
+// isSequential reports whether the tracked recent offsets are monotonically increasing
+func (b *Buffer) isSequential() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.offsets) < 2 {
+		return false
+	}
+	for i := 1; i < len(b.offsets); i++ {
+		if b.offsets[i] < b.offsets[i-1] {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// fakeDriveOpener serves Open() against a fixed in-memory byte slice, standing in for a real
+// *Drive so ChunkManager and Buffer can be exercised without a network round trip.
+type fakeDriveOpener struct {
+	data []byte
+}
+
+func (f *fakeDriveOpener) Open(ctx context.Context, object *APIObject, offset int64) (io.ReadCloser, error) {
+	if offset >= int64(len(f.data)) {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+	return ioutil.NopCloser(bytes.NewReader(f.data[offset:])), nil
+}
+
+func TestBufferReadReassemblesAlignedChunks(t *testing.T) {
+	data := []byte("abcdefghij")
+	object := &APIObject{ObjectID: "obj", Size: uint64(len(data))}
+
+	tests := []struct {
+		name   string
+		offset int64
+		size   int64
+		want   string
+	}{
+		{"read inside one chunk", 1, 2, "bc"},
+		{"read spanning a chunk boundary", 2, 4, "cdef"},
+		{"trailing partial chunk at EOF", 8, 5, "ij"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := NewChunkManager(&fakeDriveOpener{data: data}, t.TempDir(), 4, 8, 1<<20, 1, 1, time.Second)
+			if nil != err {
+				t.Fatalf("NewChunkManager() error = %v", err)
+			}
+
+			buffer, err := NewBuffer(nil, chunks, object)
+			if nil != err {
+				t.Fatalf("NewBuffer() error = %v", err)
+			}
+
+			got, err := buffer.Read(context.Background(), tt.offset, tt.size)
+			if nil != err {
+				t.Fatalf("Read(%v, %v) error = %v", tt.offset, tt.size, err)
+			}
+			if tt.want != string(got) {
+				t.Fatalf("Read(%v, %v) = %q, want %q", tt.offset, tt.size, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,27 +1,19 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/url"
 	"path/filepath"
-
 	"time"
 
 	. "github.com/claudetech/loggo/default"
 	"golang.org/x/oauth2"
-
-	"gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
 )
 
-// Cache is the cache
-type Cache struct {
-	session   *mgo.Session
-	dbName    string
-	tokenPath string
-}
-
 const (
 	// StoreAction stores an object in cache
 	StoreAction = iota
@@ -47,62 +39,121 @@ type APIObject struct {
 	CanTrash     bool
 }
 
-// Chunk is a playback chunk
-type Chunk struct {
-	ID       string `bson:"_id,omitempty"`
-	ObjectID string
-	Offset   int64
-	Size     int64
-	Bytes    []byte
-}
-
 // PageToken is the last change id
 type PageToken struct {
 	ID    string `bson:"_id,omitempty"`
 	Token string
 }
 
-// NewCache creates a new cache instance
-func NewCache(mongoURL, mongoUser, mongoPass, mongoDatabase, cacheBasePath string, sqlDebug bool) (*Cache, error) {
+// MetadataStore persists and retrieves Google Drive object metadata and the change feed's page token
+type MetadataStore interface {
+	GetObject(ctx context.Context, id string) (*APIObject, error)
+	GetObjectsByParent(ctx context.Context, parent string) ([]*APIObject, error)
+	GetObjectByParentAndName(ctx context.Context, parent, name string) (*APIObject, error)
+	DeleteObject(ctx context.Context, id string) error
+	UpdateObject(ctx context.Context, object *APIObject) error
+	StoreStartPageToken(ctx context.Context, token string) error
+	GetStartPageToken(ctx context.Context) (string, error)
+}
+
+// Cache is the cache, backed by a pluggable MetadataStore driver. Playback chunks are
+// served out of the ChunkManager's memory/disk tiers instead, see chunk_manager.go.
+type Cache struct {
+	MetadataStore
+	closer    io.Closer
+	tokenPath string
+	chunks    *ChunkManager
+}
+
+// NewCache creates a new cache instance, picking the storage driver from cacheURL's scheme
+// (mongodb://, redis:// or bolt://)
+func NewCache(cacheURL, cacheUser, cachePass, cacheDatabase, cacheBasePath string, sqlDebug bool) (*Cache, error) {
 	Log.Debugf("Opening cache connection")
 
-	session, err := mgo.Dial(mongoURL)
+	u, err := url.Parse(cacheURL)
 	if nil != err {
-		Log.Debugf("%v")
-		return nil, fmt.Errorf("Could not open mongo db connection")
+		Log.Debugf("%v", err)
+		return nil, fmt.Errorf("Could not parse cache URL %v", cacheURL)
 	}
 
-	cache := Cache{
-		session:   session,
-		dbName:    mongoDatabase,
+	cache := &Cache{
 		tokenPath: filepath.Join(cacheBasePath, "token.json"),
 	}
 
-	// getting the db
-	db := session.DB(mongoDatabase)
+	switch u.Scheme {
+	case "redis":
+		store, err := newRedisStore(cacheURL)
+		if nil != err {
+			return nil, err
+		}
+		cache.MetadataStore = store
+		cache.closer = store
+	case "bolt":
+		path := u.Opaque
+		if "" == path {
+			path = u.Path
+		}
+		if "" == path {
+			path = filepath.Join(cacheBasePath, "cache.bolt")
+		}
+		store, err := newBoltStore(path)
+		if nil != err {
+			return nil, err
+		}
+		cache.MetadataStore = store
+		cache.closer = store
+	case "mongodb", "":
+		store, err := newMongoStore(cacheURL, cacheUser, cachePass, cacheDatabase)
+		if nil != err {
+			return nil, err
+		}
+		cache.MetadataStore = store
+		cache.closer = store
+	default:
+		return nil, fmt.Errorf("Unknown cache driver %v", u.Scheme)
+	}
+
+	return cache, nil
+}
+
+// SetChunkManager wires chunks into the cache so that UpdateObject and DeleteObject evict
+// an object's cached chunks as soon as the change feed reports it changed or deleted. It is
+// a separate setter rather than a NewCache parameter because the chunk manager needs a Drive
+// client that in turn depends on the cache being open already.
+func (c *Cache) SetChunkManager(chunks *ChunkManager) {
+	c.chunks = chunks
+}
 
-	// login
-	if "" != mongoUser && "" != mongoPass {
-		db.Login(mongoUser, mongoPass)
-	}
+// Close closes all handles
+func (c *Cache) Close() error {
+	Log.Debugf("Closing cache connection")
+	return c.closer.Close()
+}
 
-	// create index
-	col := db.C("api_objects")
-	col.EnsureIndex(mgo.Index{Key: []string{"parents"}})
-	col.EnsureIndex(mgo.Index{Key: []string{"name"}})
+// UpdateObject updates an object in the store and evicts any chunks cached for it, so a
+// file that the change feed reports as modified never continues to serve stale bytes.
+func (c *Cache) UpdateObject(ctx context.Context, object *APIObject) error {
+	if err := c.MetadataStore.UpdateObject(ctx, object); nil != err {
+		return err
+	}
 
-	// delete old chunks
-	if err := cache.ClearChunks(); nil != err {
-		Log.Warningf("%v", err)
+	if nil != c.chunks {
+		c.chunks.EvictObject(object.ObjectID)
 	}
 
-	return &cache, nil
+	return nil
 }
 
-// Close closes all handles
-func (c *Cache) Close() error {
-	Log.Debugf("Closing cache connection")
-	c.session.Close()
+// DeleteObject deletes an object from the store and evicts any chunks cached for it.
+func (c *Cache) DeleteObject(ctx context.Context, id string) error {
+	if err := c.MetadataStore.DeleteObject(ctx, id); nil != err {
+		return err
+	}
+
+	if nil != c.chunks {
+		c.chunks.EvictObject(id)
+	}
+
 	return nil
 }
 
@@ -141,128 +192,3 @@ func (c *Cache) StoreToken(token *oauth2.Token) error {
 
 	return nil
 }
-
-// GetObject gets an object by id
-func (c *Cache) GetObject(id string) (*APIObject, error) {
-	Log.Tracef("Getting object %v", id)
-	db := c.session.DB(c.dbName).C("api_objects")
-
-	var object APIObject
-	if err := db.Find(bson.M{"_id": id}).One(&object); nil != err {
-		return nil, fmt.Errorf("Could not find object %v in cache", id)
-	}
-
-	Log.Tracef("Got object from cache %v", object)
-	return &object, nil
-}
-
-// GetObjectsByParent get all objects under parent id
-func (c *Cache) GetObjectsByParent(parent string) ([]*APIObject, error) {
-	Log.Tracef("Getting children for %v", parent)
-	db := c.session.DB(c.dbName).C("api_objects")
-
-	var objects []*APIObject
-	if err := db.Find(bson.M{"parents": parent}).All(&objects); nil != err {
-		return nil, fmt.Errorf("Could not find children for parent %v in cache", parent)
-	}
-
-	Log.Tracef("Got objects from cache %v", objects)
-	return objects, nil
-}
-
-// GetObjectByParentAndName finds a child element by name and its parent id
-func (c *Cache) GetObjectByParentAndName(parent, name string) (*APIObject, error) {
-	Log.Tracef("Getting object %v in parent %v", name, parent)
-	db := c.session.DB(c.dbName).C("api_objects")
-
-	var object APIObject
-	if err := db.Find(bson.M{"parents": parent, "name": name}).One(&object); nil != err {
-		return nil, fmt.Errorf("Could not find object with name %v in parent %v", name, parent)
-	}
-
-	Log.Tracef("Got object from cache %v", object)
-	return &object, nil
-}
-
-// DeleteObject deletes an object by id
-func (c *Cache) DeleteObject(id string) error {
-	db := c.session.DB(c.dbName).C("api_objects")
-
-	if err := db.Remove(bson.M{"_id": id}); nil != err {
-		return fmt.Errorf("Could not delete object %v", id)
-	}
-
-	return nil
-}
-
-// UpdateObject updates an object
-func (c *Cache) UpdateObject(object *APIObject) error {
-	db := c.session.DB(c.dbName).C("api_objects")
-
-	if _, err := db.Upsert(bson.M{"_id": object.ObjectID}, object); nil != err {
-		return fmt.Errorf("Could not update/save object %v (%v)", object.ObjectID, object.Name)
-	}
-
-	return nil
-}
-
-// StoreStartPageToken stores the page token for changes
-func (c *Cache) StoreStartPageToken(token string) error {
-	Log.Debugf("Storing page token %v in cache", token)
-	db := c.session.DB(c.dbName).C("page_token")
-
-	if _, err := db.Upsert(bson.M{"_id": "t"}, &PageToken{ID: "t", Token: token}); nil != err {
-		return fmt.Errorf("Could not store token %v", token)
-	}
-
-	return nil
-}
-
-// GetStartPageToken gets the start page token
-func (c *Cache) GetStartPageToken() (string, error) {
-	Log.Debugf("Getting start page token from cache")
-	db := c.session.DB(c.dbName).C("page_token")
-
-	var pageToken PageToken
-	if err := db.Find(nil).One(&pageToken); nil != err {
-		return "", fmt.Errorf("Could not get token from cache")
-	}
-
-	Log.Tracef("Got start page token %v", pageToken.Token)
-	return pageToken.Token, nil
-}
-
-// StoreChunk stores a chunk in the cache
-func (c *Cache) StoreChunk(chunk *Chunk) error {
-	db := c.session.DB(c.dbName).C("chunks")
-
-	if _, err := db.Upsert(bson.M{"_id": chunk.ID}, &chunk); nil != err {
-		Log.Debugf("%v", err)
-		return fmt.Errorf("Could not store chunk %v", chunk.ID)
-	}
-
-	return nil
-}
-
-// LoadChunk loads a chunk from the cache
-func (c *Cache) LoadChunk(id string) (*Chunk, error) {
-	db := c.session.DB(c.dbName).C("chunks")
-
-	var chunk Chunk
-	if err := db.Find(bson.M{"_id": id}).One(&chunk); nil != err {
-		return nil, fmt.Errorf("Could not get chunk %v from cache", id)
-	}
-
-	return &chunk, nil
-}
-
-// ClearChunks removes all chunks
-func (c *Cache) ClearChunks() error {
-	db := c.session.DB(c.dbName).C("chunks")
-
-	if _, err := db.RemoveAll(bson.M{}); nil != err {
-		return fmt.Errorf("Could not delete chunks")
-	}
-
-	return nil
-}
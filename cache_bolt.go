@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	. "github.com/claudetech/loggo/default"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	boltObjectsBucket = []byte("api_objects")
+	boltMetaBucket    = []byte("meta")
+)
+
+const boltPageTokenKey = "page_token"
+
+// boltStore is the embedded BoltDB backed MetadataStore implementation, for single-node
+// deployments that don't want to run an external database.
+type boltStore struct {
+	db *bolt.DB
+}
+
+// newBoltStore creates a new BoltDB backed store at path
+func newBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if nil != err {
+		Log.Debugf("%v", err)
+		return nil, fmt.Errorf("Could not open bolt db at %v", path)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltObjectsBucket, boltMetaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); nil != err {
+				return err
+			}
+		}
+		return nil
+	})
+	if nil != err {
+		Log.Debugf("%v", err)
+		return nil, fmt.Errorf("Could not initialize bolt db at %v", path)
+	}
+
+	return &boltStore{db: db}, nil
+}
+
+// Close closes the bolt db handle
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// GetObject gets an object by id
+func (s *boltStore) GetObject(ctx context.Context, id string) (*APIObject, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+
+	Log.Tracef("Getting object %v", id)
+
+	var object APIObject
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltObjectsBucket).Get([]byte(id))
+		if nil == data {
+			return fmt.Errorf("object %v not found", id)
+		}
+		return json.Unmarshal(data, &object)
+	})
+	if nil != err {
+		return nil, fmt.Errorf("Could not find object %v in cache", id)
+	}
+
+	Log.Tracef("Got object from cache %v", object)
+	return &object, nil
+}
+
+// GetObjectsByParent get all objects under parent id
+func (s *boltStore) GetObjectsByParent(ctx context.Context, parent string) ([]*APIObject, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+
+	Log.Tracef("Getting children for %v", parent)
+
+	var objects []*APIObject
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltObjectsBucket).ForEach(func(k, v []byte) error {
+			var object APIObject
+			if err := json.Unmarshal(v, &object); nil != err {
+				return nil
+			}
+			for _, p := range object.Parents {
+				if parent == p {
+					objects = append(objects, &object)
+					break
+				}
+			}
+			return nil
+		})
+	})
+	if nil != err {
+		return nil, fmt.Errorf("Could not find children for parent %v in cache", parent)
+	}
+
+	Log.Tracef("Got objects from cache %v", objects)
+	return objects, nil
+}
+
+// GetObjectByParentAndName finds a child element by name and its parent id
+func (s *boltStore) GetObjectByParentAndName(ctx context.Context, parent, name string) (*APIObject, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+
+	Log.Tracef("Getting object %v in parent %v", name, parent)
+
+	objects, err := s.GetObjectsByParent(ctx, parent)
+	if nil != err {
+		return nil, fmt.Errorf("Could not find object with name %v in parent %v", name, parent)
+	}
+
+	for _, object := range objects {
+		if object.Name == name {
+			Log.Tracef("Got object from cache %v", object)
+			return object, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Could not find object with name %v in parent %v", name, parent)
+}
+
+// DeleteObject deletes an object by id
+func (s *boltStore) DeleteObject(ctx context.Context, id string) error {
+	if err := ctx.Err(); nil != err {
+		return err
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltObjectsBucket).Delete([]byte(id))
+	})
+	if nil != err {
+		return fmt.Errorf("Could not delete object %v", id)
+	}
+
+	return nil
+}
+
+// UpdateObject updates an object
+func (s *boltStore) UpdateObject(ctx context.Context, object *APIObject) error {
+	if err := ctx.Err(); nil != err {
+		return err
+	}
+
+	data, err := json.Marshal(object)
+	if nil != err {
+		return fmt.Errorf("Could not update/save object %v (%v)", object.ObjectID, object.Name)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltObjectsBucket).Put([]byte(object.ObjectID), data)
+	})
+	if nil != err {
+		return fmt.Errorf("Could not update/save object %v (%v)", object.ObjectID, object.Name)
+	}
+
+	return nil
+}
+
+// StoreStartPageToken stores the page token for changes
+func (s *boltStore) StoreStartPageToken(ctx context.Context, token string) error {
+	if err := ctx.Err(); nil != err {
+		return err
+	}
+
+	Log.Debugf("Storing page token %v in cache", token)
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltMetaBucket).Put([]byte(boltPageTokenKey), []byte(token))
+	})
+	if nil != err {
+		return fmt.Errorf("Could not store token %v", token)
+	}
+
+	return nil
+}
+
+// GetStartPageToken gets the start page token
+func (s *boltStore) GetStartPageToken(ctx context.Context) (string, error) {
+	if err := ctx.Err(); nil != err {
+		return "", err
+	}
+
+	Log.Debugf("Getting start page token from cache")
+
+	var token string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltMetaBucket).Get([]byte(boltPageTokenKey))
+		if nil == data {
+			return fmt.Errorf("no page token stored")
+		}
+		token = string(data)
+		return nil
+	})
+	if nil != err {
+		return "", fmt.Errorf("Could not get token from cache")
+	}
+
+	Log.Tracef("Got start page token %v", token)
+	return token, nil
+}
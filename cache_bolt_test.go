@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBoltStoreObjectRoundTrip(t *testing.T) {
+	store, err := newBoltStore(filepath.Join(t.TempDir(), "cache.bolt"))
+	if nil != err {
+		t.Fatalf("newBoltStore() error = %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	object := &APIObject{
+		ObjectID:     "obj1",
+		Name:         "file.txt",
+		Parents:      []string{"root"},
+		LastModified: time.Now().Truncate(time.Second),
+	}
+
+	if err := store.UpdateObject(ctx, object); nil != err {
+		t.Fatalf("UpdateObject() error = %v", err)
+	}
+
+	got, err := store.GetObject(ctx, object.ObjectID)
+	if nil != err {
+		t.Fatalf("GetObject() error = %v", err)
+	}
+	if got.Name != object.Name {
+		t.Errorf("GetObject().Name = %v, want %v", got.Name, object.Name)
+	}
+
+	byName, err := store.GetObjectByParentAndName(ctx, "root", "file.txt")
+	if nil != err {
+		t.Fatalf("GetObjectByParentAndName() error = %v", err)
+	}
+	if byName.ObjectID != object.ObjectID {
+		t.Errorf("GetObjectByParentAndName().ObjectID = %v, want %v", byName.ObjectID, object.ObjectID)
+	}
+
+	children, err := store.GetObjectsByParent(ctx, "root")
+	if nil != err {
+		t.Fatalf("GetObjectsByParent() error = %v", err)
+	}
+	if 1 != len(children) {
+		t.Fatalf("GetObjectsByParent() returned %v objects, want 1", len(children))
+	}
+
+	if err := store.DeleteObject(ctx, object.ObjectID); nil != err {
+		t.Fatalf("DeleteObject() error = %v", err)
+	}
+	if _, err := store.GetObject(ctx, object.ObjectID); nil == err {
+		t.Fatal("expected GetObject to fail for a deleted object")
+	}
+}
+
+func TestBoltStorePageTokenRoundTrip(t *testing.T) {
+	store, err := newBoltStore(filepath.Join(t.TempDir(), "cache.bolt"))
+	if nil != err {
+		t.Fatalf("newBoltStore() error = %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.StoreStartPageToken(ctx, "token-1"); nil != err {
+		t.Fatalf("StoreStartPageToken() error = %v", err)
+	}
+
+	token, err := store.GetStartPageToken(ctx)
+	if nil != err {
+		t.Fatalf("GetStartPageToken() error = %v", err)
+	}
+	if "token-1" != token {
+		t.Errorf("GetStartPageToken() = %v, want token-1", token)
+	}
+}
+
+func TestNewCacheBoltSchemeUsesBoltStore(t *testing.T) {
+	cacheURL := "bolt://" + filepath.Join(t.TempDir(), "cache.bolt")
+	cache, err := NewCache(cacheURL, "", "", "", t.TempDir(), false)
+	if nil != err {
+		t.Fatalf("NewCache() error = %v", err)
+	}
+	defer cache.Close()
+
+	if _, ok := cache.MetadataStore.(*boltStore); !ok {
+		t.Fatalf("NewCache(%v).MetadataStore = %T, want *boltStore", cacheURL, cache.MetadataStore)
+	}
+}
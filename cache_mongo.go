@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/claudetech/loggo/default"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// mongoStore is the MongoDB backed MetadataStore implementation
+type mongoStore struct {
+	session *mgo.Session
+	dbName  string
+}
+
+// newMongoStore creates a new MongoDB backed store
+func newMongoStore(mongoURL, mongoUser, mongoPass, mongoDatabase string) (*mongoStore, error) {
+	session, err := mgo.Dial(mongoURL)
+	if nil != err {
+		Log.Debugf("%v", err)
+		return nil, fmt.Errorf("Could not open mongo db connection")
+	}
+
+	store := mongoStore{
+		session: session,
+		dbName:  mongoDatabase,
+	}
+
+	// getting the db
+	db := session.DB(mongoDatabase)
+
+	// login
+	if "" != mongoUser && "" != mongoPass {
+		db.Login(mongoUser, mongoPass)
+	}
+
+	// create index
+	col := db.C("api_objects")
+	col.EnsureIndex(mgo.Index{Key: []string{"parents"}})
+	col.EnsureIndex(mgo.Index{Key: []string{"name"}})
+
+	return &store, nil
+}
+
+// Close closes the mongo session
+func (s *mongoStore) Close() error {
+	s.session.Close()
+	return nil
+}
+
+// GetObject gets an object by id
+func (s *mongoStore) GetObject(ctx context.Context, id string) (*APIObject, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+
+	Log.Tracef("Getting object %v", id)
+	db := s.session.DB(s.dbName).C("api_objects")
+
+	var object APIObject
+	if err := db.Find(bson.M{"_id": id}).One(&object); nil != err {
+		return nil, fmt.Errorf("Could not find object %v in cache", id)
+	}
+
+	Log.Tracef("Got object from cache %v", object)
+	return &object, nil
+}
+
+// GetObjectsByParent get all objects under parent id
+func (s *mongoStore) GetObjectsByParent(ctx context.Context, parent string) ([]*APIObject, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+
+	Log.Tracef("Getting children for %v", parent)
+	db := s.session.DB(s.dbName).C("api_objects")
+
+	var objects []*APIObject
+	if err := db.Find(bson.M{"parents": parent}).All(&objects); nil != err {
+		return nil, fmt.Errorf("Could not find children for parent %v in cache", parent)
+	}
+
+	Log.Tracef("Got objects from cache %v", objects)
+	return objects, nil
+}
+
+// GetObjectByParentAndName finds a child element by name and its parent id
+func (s *mongoStore) GetObjectByParentAndName(ctx context.Context, parent, name string) (*APIObject, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+
+	Log.Tracef("Getting object %v in parent %v", name, parent)
+	db := s.session.DB(s.dbName).C("api_objects")
+
+	var object APIObject
+	if err := db.Find(bson.M{"parents": parent, "name": name}).One(&object); nil != err {
+		return nil, fmt.Errorf("Could not find object with name %v in parent %v", name, parent)
+	}
+
+	Log.Tracef("Got object from cache %v", object)
+	return &object, nil
+}
+
+// DeleteObject deletes an object by id
+func (s *mongoStore) DeleteObject(ctx context.Context, id string) error {
+	if err := ctx.Err(); nil != err {
+		return err
+	}
+
+	db := s.session.DB(s.dbName).C("api_objects")
+
+	if err := db.Remove(bson.M{"_id": id}); nil != err {
+		return fmt.Errorf("Could not delete object %v", id)
+	}
+
+	return nil
+}
+
+// UpdateObject updates an object
+func (s *mongoStore) UpdateObject(ctx context.Context, object *APIObject) error {
+	if err := ctx.Err(); nil != err {
+		return err
+	}
+
+	db := s.session.DB(s.dbName).C("api_objects")
+
+	if _, err := db.Upsert(bson.M{"_id": object.ObjectID}, object); nil != err {
+		return fmt.Errorf("Could not update/save object %v (%v)", object.ObjectID, object.Name)
+	}
+
+	return nil
+}
+
+// StoreStartPageToken stores the page token for changes
+func (s *mongoStore) StoreStartPageToken(ctx context.Context, token string) error {
+	if err := ctx.Err(); nil != err {
+		return err
+	}
+
+	Log.Debugf("Storing page token %v in cache", token)
+	db := s.session.DB(s.dbName).C("page_token")
+
+	if _, err := db.Upsert(bson.M{"_id": "t"}, &PageToken{ID: "t", Token: token}); nil != err {
+		return fmt.Errorf("Could not store token %v", token)
+	}
+
+	return nil
+}
+
+// GetStartPageToken gets the start page token
+func (s *mongoStore) GetStartPageToken(ctx context.Context) (string, error) {
+	if err := ctx.Err(); nil != err {
+		return "", err
+	}
+
+	Log.Debugf("Getting start page token from cache")
+	db := s.session.DB(s.dbName).C("page_token")
+
+	var pageToken PageToken
+	if err := db.Find(nil).One(&pageToken); nil != err {
+		return "", fmt.Errorf("Could not get token from cache")
+	}
+
+	Log.Tracef("Got start page token %v", pageToken.Token)
+	return pageToken.Token, nil
+}
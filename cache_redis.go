@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	. "github.com/claudetech/loggo/default"
+
+	"gopkg.in/redis.v5"
+)
+
+const redisPageTokenKey = "plexdrive:page_token"
+
+// redisStore is the Redis backed MetadataStore implementation. Objects are stored as
+// JSON blobs, indexed by parent id via sets and by parent/name via hashes so lookups
+// don't require scanning.
+type redisStore struct {
+	client *redis.Client
+}
+
+// newRedisStore creates a new Redis backed store
+func newRedisStore(redisURL string) (*redisStore, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if nil != err {
+		Log.Debugf("%v", err)
+		return nil, fmt.Errorf("Could not parse redis URL %v", redisURL)
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping().Err(); nil != err {
+		Log.Debugf("%v", err)
+		return nil, fmt.Errorf("Could not open redis connection")
+	}
+
+	return &redisStore{client: client}, nil
+}
+
+// Close closes the redis connection
+func (s *redisStore) Close() error {
+	return s.client.Close()
+}
+
+func redisObjectKey(id string) string {
+	return fmt.Sprintf("plexdrive:object:%v", id)
+}
+
+func redisParentSetKey(parent string) string {
+	return fmt.Sprintf("plexdrive:children:%v", parent)
+}
+
+func redisParentNameKey(parent string) string {
+	return fmt.Sprintf("plexdrive:names:%v", parent)
+}
+
+// GetObject gets an object by id
+func (s *redisStore) GetObject(ctx context.Context, id string) (*APIObject, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+
+	Log.Tracef("Getting object %v", id)
+
+	data, err := s.client.Get(redisObjectKey(id)).Bytes()
+	if nil != err {
+		return nil, fmt.Errorf("Could not find object %v in cache", id)
+	}
+
+	var object APIObject
+	if err := json.Unmarshal(data, &object); nil != err {
+		return nil, fmt.Errorf("Could not find object %v in cache", id)
+	}
+
+	Log.Tracef("Got object from cache %v", object)
+	return &object, nil
+}
+
+// GetObjectsByParent get all objects under parent id
+func (s *redisStore) GetObjectsByParent(ctx context.Context, parent string) ([]*APIObject, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+
+	Log.Tracef("Getting children for %v", parent)
+
+	ids, err := s.client.SMembers(redisParentSetKey(parent)).Result()
+	if nil != err {
+		return nil, fmt.Errorf("Could not find children for parent %v in cache", parent)
+	}
+
+	objects := make([]*APIObject, 0, len(ids))
+	for _, id := range ids {
+		object, err := s.GetObject(ctx, id)
+		if nil != err {
+			// the index entry is stale, drop the reference instead of failing the whole listing
+			s.client.SRem(redisParentSetKey(parent), id)
+			continue
+		}
+		objects = append(objects, object)
+	}
+
+	Log.Tracef("Got objects from cache %v", objects)
+	return objects, nil
+}
+
+// GetObjectByParentAndName finds a child element by name and its parent id
+func (s *redisStore) GetObjectByParentAndName(ctx context.Context, parent, name string) (*APIObject, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+
+	Log.Tracef("Getting object %v in parent %v", name, parent)
+
+	id, err := s.client.HGet(redisParentNameKey(parent), name).Result()
+	if nil != err {
+		return nil, fmt.Errorf("Could not find object with name %v in parent %v", name, parent)
+	}
+
+	object, err := s.GetObject(ctx, id)
+	if nil != err {
+		return nil, fmt.Errorf("Could not find object with name %v in parent %v", name, parent)
+	}
+
+	Log.Tracef("Got object from cache %v", object)
+	return object, nil
+}
+
+// DeleteObject deletes an object by id
+func (s *redisStore) DeleteObject(ctx context.Context, id string) error {
+	if err := ctx.Err(); nil != err {
+		return err
+	}
+
+	object, err := s.GetObject(ctx, id)
+	if nil == err {
+		for _, parent := range object.Parents {
+			s.client.SRem(redisParentSetKey(parent), id)
+			s.client.HDel(redisParentNameKey(parent), object.Name)
+		}
+	}
+
+	if err := s.client.Del(redisObjectKey(id)).Err(); nil != err {
+		return fmt.Errorf("Could not delete object %v", id)
+	}
+
+	return nil
+}
+
+// UpdateObject updates an object
+func (s *redisStore) UpdateObject(ctx context.Context, object *APIObject) error {
+	if err := ctx.Err(); nil != err {
+		return err
+	}
+
+	data, err := json.Marshal(object)
+	if nil != err {
+		return fmt.Errorf("Could not update/save object %v (%v)", object.ObjectID, object.Name)
+	}
+
+	// drop stale parent/name index entries before writing the new ones
+	if old, err := s.GetObject(ctx, object.ObjectID); nil == err {
+		for _, parent := range old.Parents {
+			s.client.SRem(redisParentSetKey(parent), object.ObjectID)
+			s.client.HDel(redisParentNameKey(parent), old.Name)
+		}
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(redisObjectKey(object.ObjectID), data, 0)
+	for _, parent := range object.Parents {
+		pipe.SAdd(redisParentSetKey(parent), object.ObjectID)
+		pipe.HSet(redisParentNameKey(parent), object.Name, object.ObjectID)
+	}
+
+	if _, err := pipe.Exec(); nil != err {
+		return fmt.Errorf("Could not update/save object %v (%v)", object.ObjectID, object.Name)
+	}
+
+	return nil
+}
+
+// StoreStartPageToken stores the page token for changes
+func (s *redisStore) StoreStartPageToken(ctx context.Context, token string) error {
+	if err := ctx.Err(); nil != err {
+		return err
+	}
+
+	Log.Debugf("Storing page token %v in cache", token)
+
+	if err := s.client.Set(redisPageTokenKey, token, 0).Err(); nil != err {
+		return fmt.Errorf("Could not store token %v", token)
+	}
+
+	return nil
+}
+
+// GetStartPageToken gets the start page token
+func (s *redisStore) GetStartPageToken(ctx context.Context) (string, error) {
+	if err := ctx.Err(); nil != err {
+		return "", err
+	}
+
+	Log.Debugf("Getting start page token from cache")
+
+	token, err := s.client.Get(redisPageTokenKey).Result()
+	if nil != err {
+		return "", fmt.Errorf("Could not get token from cache")
+	}
+
+	Log.Tracef("Got start page token %v", token)
+	return token, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeMetadataStore is a minimal in-memory MetadataStore for exercising Cache's eviction
+// wiring without a real backend.
+type fakeMetadataStore struct {
+	objects map[string]*APIObject
+}
+
+func newFakeMetadataStore() *fakeMetadataStore {
+	return &fakeMetadataStore{objects: make(map[string]*APIObject)}
+}
+
+func (s *fakeMetadataStore) GetObject(ctx context.Context, id string) (*APIObject, error) {
+	if object, ok := s.objects[id]; ok {
+		return object, nil
+	}
+	return nil, fmt.Errorf("object %v not found", id)
+}
+
+func (s *fakeMetadataStore) GetObjectsByParent(ctx context.Context, parent string) ([]*APIObject, error) {
+	return nil, nil
+}
+
+func (s *fakeMetadataStore) GetObjectByParentAndName(ctx context.Context, parent, name string) (*APIObject, error) {
+	return nil, fmt.Errorf("object not found")
+}
+
+func (s *fakeMetadataStore) DeleteObject(ctx context.Context, id string) error {
+	delete(s.objects, id)
+	return nil
+}
+
+func (s *fakeMetadataStore) UpdateObject(ctx context.Context, object *APIObject) error {
+	s.objects[object.ObjectID] = object
+	return nil
+}
+
+func (s *fakeMetadataStore) StoreStartPageToken(ctx context.Context, token string) error {
+	return nil
+}
+
+func (s *fakeMetadataStore) GetStartPageToken(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+// TestCacheUpdateAndDeleteObjectEvictChunks verifies that once a ChunkManager is wired in via
+// SetChunkManager, the cache's UpdateObject/DeleteObject calls (as used by the change feed)
+// evict the affected object's chunks instead of leaving them to be served stale indefinitely.
+func TestCacheUpdateAndDeleteObjectEvictChunks(t *testing.T) {
+	chunks, err := NewChunkManager(nil, t.TempDir(), DefaultChunkSize, 4, 1024*1024, 1, 1, time.Second)
+	if nil != err {
+		t.Fatalf("NewChunkManager() error = %v", err)
+	}
+
+	cache := &Cache{MetadataStore: newFakeMetadataStore()}
+	cache.SetChunkManager(chunks)
+
+	object := &APIObject{ObjectID: "obj"}
+	key := chunkKey{ObjectID: object.ObjectID, Index: 0}
+
+	chunks.memory.Put(key, []byte("stale"))
+	if err := cache.UpdateObject(context.Background(), object); nil != err {
+		t.Fatalf("UpdateObject() error = %v", err)
+	}
+	if _, ok := chunks.memory.Get(key); ok {
+		t.Fatal("expected UpdateObject to evict the object's cached chunks")
+	}
+
+	chunks.memory.Put(key, []byte("stale again"))
+	if err := cache.DeleteObject(context.Background(), object.ObjectID); nil != err {
+		t.Fatalf("DeleteObject() error = %v", err)
+	}
+	if _, ok := chunks.memory.Get(key); ok {
+		t.Fatal("expected DeleteObject to evict the object's cached chunks")
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/claudetech/loggo/default"
+)
+
+// diskChunkEntry is a single entry in diskChunkCache's LRU list
+type diskChunkEntry struct {
+	key          chunkKey
+	size         int64
+	lastModified time.Time
+	lastAccess   time.Time
+}
+
+// chunkManifestEntry is the on-disk representation of a diskChunkEntry, persisted so the
+// cache can be rebuilt without wiping it on restart
+type chunkManifestEntry struct {
+	ObjectID     string    `json:"objectId"`
+	ChunkIndex   int64     `json:"chunkIndex"`
+	ByteSize     int64     `json:"byteSize"`
+	LastAccess   time.Time `json:"lastAccess"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// diskChunkCache is a persistent, disk-backed LRU cache of chunks, bounded by total byte size.
+// Chunks are stored as one file per chunk under basePath; a manifest file alongside them
+// records each chunk's size, access time and the LastModified of the object it belongs to,
+// so the cache survives restarts instead of starting cold every time, and a chunk whose
+// object has since changed is detected and evicted automatically.
+type diskChunkCache struct {
+	basePath string
+	maxBytes int64
+
+	mu        sync.Mutex
+	usedBytes int64
+	order     *list.List
+	index     map[chunkKey]*list.Element
+}
+
+func newDiskChunkCache(basePath string, maxBytes int64) (*diskChunkCache, error) {
+	if err := os.MkdirAll(basePath, 0755); nil != err {
+		Log.Debugf("%v", err)
+		return nil, fmt.Errorf("Could not create chunk cache directory %v", basePath)
+	}
+
+	cache := &diskChunkCache{
+		basePath: basePath,
+		maxBytes: maxBytes,
+		order:    list.New(),
+		index:    make(map[chunkKey]*list.Element),
+	}
+
+	cache.reload()
+
+	return cache, nil
+}
+
+// reload rebuilds the in-memory LRU index from the manifest file, oldest access first, then
+// removes any chunk file on disk that the manifest no longer references
+func (c *diskChunkCache) reload() {
+	data, err := ioutil.ReadFile(c.manifestPath())
+	if nil != err {
+		if !os.IsNotExist(err) {
+			Log.Warningf("Could not read chunk manifest, starting with an empty cache (%v)", err)
+		}
+		c.pruneOrphans()
+		return
+	}
+
+	var entries []chunkManifestEntry
+	if err := json.Unmarshal(data, &entries); nil != err {
+		Log.Warningf("Could not parse chunk manifest, starting with an empty cache (%v)", err)
+		c.pruneOrphans()
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastAccess.Before(entries[j].LastAccess)
+	})
+
+	for _, e := range entries {
+		key := chunkKey{ObjectID: e.ObjectID, Index: e.ChunkIndex}
+
+		info, err := os.Stat(c.path(key))
+		if nil != err {
+			// manifest entry with no backing file left, drop it silently
+			continue
+		}
+
+		entry := &diskChunkEntry{
+			key:          key,
+			size:         info.Size(),
+			lastModified: e.LastModified,
+			lastAccess:   e.LastAccess,
+		}
+		c.index[key] = c.order.PushBack(entry)
+		c.usedBytes += entry.size
+	}
+
+	c.evict()
+	c.pruneOrphans()
+}
+
+// pruneOrphans removes chunk files that aren't tracked by the in-memory index, e.g. leftovers
+// from a crash between writing the chunk and persisting the manifest
+func (c *diskChunkCache) pruneOrphans() {
+	files, err := ioutil.ReadDir(c.basePath)
+	if nil != err {
+		return
+	}
+
+	for _, file := range files {
+		key, ok := parseChunkFileName(file.Name())
+		if !ok {
+			continue
+		}
+		if _, tracked := c.index[key]; !tracked {
+			os.Remove(filepath.Join(c.basePath, file.Name()))
+		}
+	}
+}
+
+func chunkFileName(key chunkKey) string {
+	return fmt.Sprintf("%v_%v.chunk", key.ObjectID, key.Index)
+}
+
+func parseChunkFileName(name string) (chunkKey, bool) {
+	if !strings.HasSuffix(name, ".chunk") {
+		return chunkKey{}, false
+	}
+
+	// object IDs may contain underscores, so the index is whatever follows the last one
+	base := strings.TrimSuffix(name, ".chunk")
+	sep := strings.LastIndex(base, "_")
+	if sep < 0 {
+		return chunkKey{}, false
+	}
+
+	index, err := strconv.ParseInt(base[sep+1:], 10, 64)
+	if nil != err {
+		return chunkKey{}, false
+	}
+
+	return chunkKey{ObjectID: base[:sep], Index: index}, true
+}
+
+func (c *diskChunkCache) path(key chunkKey) string {
+	return filepath.Join(c.basePath, chunkFileName(key))
+}
+
+func (c *diskChunkCache) manifestPath() string {
+	return filepath.Join(c.basePath, "manifest.json")
+}
+
+// Get returns the bytes for key, marking it most recently used. If the chunk was persisted
+// for an object with a different lastModified than the one passed in, the object has since
+// been overwritten, so the chunk is stale and is evicted instead of being returned.
+func (c *diskChunkCache) Get(key chunkKey, lastModified time.Time) ([]byte, bool) {
+	c.mu.Lock()
+	elem, ok := c.index[key]
+	if !ok {
+		c.mu.Unlock()
+		return nil, false
+	}
+
+	entry := elem.Value.(*diskChunkEntry)
+	if !entry.lastModified.Equal(lastModified) {
+		Log.Debugf("Evicting stale chunk %v:%v, object was modified", key.ObjectID, key.Index)
+		c.removeLocked(elem)
+		c.saveManifest()
+		c.mu.Unlock()
+		return nil, false
+	}
+
+	entry.lastAccess = time.Now()
+	c.order.MoveToBack(elem)
+	c.mu.Unlock()
+
+	bytes, err := ioutil.ReadFile(c.path(key))
+	if nil != err {
+		Log.Debugf("%v", err)
+		return nil, false
+	}
+
+	return bytes, true
+}
+
+// Put persists bytes for key to disk, evicting the least recently used chunks until the
+// cache is back under its byte budget, and updates the manifest
+func (c *diskChunkCache) Put(key chunkKey, bytes []byte, lastModified time.Time) {
+	if err := ioutil.WriteFile(c.path(key), bytes, 0644); nil != err {
+		Log.Warningf("Could not persist chunk %v:%v to disk (%v)", key.ObjectID, key.Index, err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.index[key]; ok {
+		c.usedBytes -= elem.Value.(*diskChunkEntry).size
+		c.order.Remove(elem)
+	}
+
+	entry := &diskChunkEntry{
+		key:          key,
+		size:         int64(len(bytes)),
+		lastModified: lastModified,
+		lastAccess:   time.Now(),
+	}
+	c.index[key] = c.order.PushBack(entry)
+	c.usedBytes += entry.size
+
+	c.evict()
+	c.saveManifest()
+}
+
+// EvictObject removes every cached chunk belonging to objectID. It is meant to be called from
+// the change-feed handler as soon as that object is reported changed or deleted, so a stale
+// chunk never outlives the content it was read from.
+func (c *diskChunkCache) EvictObject(objectID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, elem := range c.index {
+		if objectID == key.ObjectID {
+			c.removeLocked(elem)
+		}
+	}
+
+	c.saveManifest()
+}
+
+// evict removes the least recently used chunks until usedBytes is back under maxBytes.
+// Callers must hold c.mu.
+func (c *diskChunkCache) evict() {
+	for c.usedBytes > c.maxBytes {
+		front := c.order.Front()
+		if nil == front {
+			break
+		}
+		c.removeLocked(front)
+	}
+}
+
+// removeLocked drops elem from the index and deletes its backing file. Callers must hold c.mu.
+func (c *diskChunkCache) removeLocked(elem *list.Element) {
+	entry := elem.Value.(*diskChunkEntry)
+	c.order.Remove(elem)
+	delete(c.index, entry.key)
+	c.usedBytes -= entry.size
+
+	if err := os.Remove(c.path(entry.key)); nil != err && !os.IsNotExist(err) {
+		Log.Warningf("Could not remove chunk %v:%v (%v)", entry.key.ObjectID, entry.key.Index, err)
+	}
+}
+
+// saveManifest writes the current index out to the manifest file. Callers must hold c.mu.
+func (c *diskChunkCache) saveManifest() {
+	entries := make([]chunkManifestEntry, 0, c.order.Len())
+	for e := c.order.Front(); nil != e; e = e.Next() {
+		entry := e.Value.(*diskChunkEntry)
+		entries = append(entries, chunkManifestEntry{
+			ObjectID:     entry.key.ObjectID,
+			ChunkIndex:   entry.key.Index,
+			ByteSize:     entry.size,
+			LastAccess:   entry.lastAccess,
+			LastModified: entry.lastModified,
+		})
+	}
+
+	data, err := json.Marshal(entries)
+	if nil != err {
+		Log.Warningf("Could not encode chunk manifest (%v)", err)
+		return
+	}
+
+	tmpPath := c.manifestPath() + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); nil != err {
+		Log.Warningf("Could not write chunk manifest (%v)", err)
+		return
+	}
+	if err := os.Rename(tmpPath, c.manifestPath()); nil != err {
+		Log.Warningf("Could not persist chunk manifest (%v)", err)
+	}
+}
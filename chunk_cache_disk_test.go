@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiskChunkCachePersistsAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	lastModified := time.Now()
+	key := chunkKey{ObjectID: "obj", Index: 0}
+
+	cache, err := newDiskChunkCache(dir, 1<<20)
+	if nil != err {
+		t.Fatalf("newDiskChunkCache() error = %v", err)
+	}
+	cache.Put(key, []byte("hello"), lastModified)
+
+	reopened, err := newDiskChunkCache(dir, 1<<20)
+	if nil != err {
+		t.Fatalf("newDiskChunkCache() reopen error = %v", err)
+	}
+
+	bytes, ok := reopened.Get(key, lastModified)
+	if !ok {
+		t.Fatal("expected the chunk written before the restart to still be cached after reopening the same basePath")
+	}
+	if "hello" != string(bytes) {
+		t.Fatalf("Get() = %q, want %q", bytes, "hello")
+	}
+}
+
+func TestDiskChunkCacheEvictsOnLastModifiedMismatch(t *testing.T) {
+	dir := t.TempDir()
+	key := chunkKey{ObjectID: "obj", Index: 0}
+
+	cache, err := newDiskChunkCache(dir, 1<<20)
+	if nil != err {
+		t.Fatalf("newDiskChunkCache() error = %v", err)
+	}
+	cache.Put(key, []byte("hello"), time.Unix(1000, 0))
+
+	if _, ok := cache.Get(key, time.Unix(2000, 0)); ok {
+		t.Fatal("expected a chunk persisted for a different LastModified to be treated as a miss")
+	}
+	if _, ok := cache.Get(key, time.Unix(1000, 0)); ok {
+		t.Fatal("expected the stale chunk to have been evicted outright, not just hidden from the mismatched lookup")
+	}
+}
+
+func TestDiskChunkCacheEvictsLeastRecentlyUsedOverByteBudget(t *testing.T) {
+	dir := t.TempDir()
+	lastModified := time.Now()
+
+	// Each chunk is 5 bytes; a 10 byte budget holds exactly two of them.
+	cache, err := newDiskChunkCache(dir, 10)
+	if nil != err {
+		t.Fatalf("newDiskChunkCache() error = %v", err)
+	}
+
+	older := chunkKey{ObjectID: "obj", Index: 0}
+	newer := chunkKey{ObjectID: "obj", Index: 1}
+	cache.Put(older, []byte("aaaaa"), lastModified)
+	cache.Put(newer, []byte("bbbbb"), lastModified)
+
+	// Access older so it becomes the most recently used entry, leaving newer as the one
+	// that should be evicted once a third chunk pushes the cache over budget.
+	if _, ok := cache.Get(older, lastModified); !ok {
+		t.Fatal("expected older to still be cached before the third Put")
+	}
+
+	third := chunkKey{ObjectID: "obj", Index: 2}
+	cache.Put(third, []byte("ccccc"), lastModified)
+
+	if _, ok := cache.Get(newer, lastModified); ok {
+		t.Fatal("expected the least recently accessed chunk to be evicted once maxBytes was exceeded")
+	}
+	if _, ok := cache.Get(older, lastModified); !ok {
+		t.Fatal("expected the more recently accessed chunk to survive eviction")
+	}
+	if _, ok := cache.Get(third, lastModified); !ok {
+		t.Fatal("expected the just-written chunk to be present")
+	}
+}
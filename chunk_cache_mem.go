@@ -0,0 +1,75 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// memChunkEntry is a single entry in memChunkCache's LRU list
+type memChunkEntry struct {
+	key   chunkKey
+	bytes []byte
+}
+
+// memChunkCache is an in-memory LRU cache of decoded chunks, bounded by entry count
+type memChunkCache struct {
+	maxEntries int
+	mu         sync.Mutex
+	order      *list.List
+	index      map[chunkKey]*list.Element
+}
+
+func newMemChunkCache(maxEntries int) *memChunkCache {
+	return &memChunkCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		index:      make(map[chunkKey]*list.Element),
+	}
+}
+
+// Get returns the cached bytes for key, marking it most recently used
+func (c *memChunkCache) Get(key chunkKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.index[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToBack(elem)
+
+	return elem.Value.(*memChunkEntry).bytes, true
+}
+
+// Put stores bytes for key, evicting the least recently used entry if the cache is full
+func (c *memChunkCache) Put(key chunkKey, bytes []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.index[key]; ok {
+		c.order.Remove(elem)
+	}
+	c.index[key] = c.order.PushBack(&memChunkEntry{key: key, bytes: bytes})
+
+	for c.order.Len() > c.maxEntries {
+		front := c.order.Front()
+		if nil == front {
+			break
+		}
+		c.order.Remove(front)
+		delete(c.index, front.Value.(*memChunkEntry).key)
+	}
+}
+
+// EvictObject removes every cached chunk belonging to objectID
+func (c *memChunkCache) EvictObject(objectID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, elem := range c.index {
+		if objectID == key.ObjectID {
+			c.order.Remove(elem)
+			delete(c.index, key)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	. "github.com/claudetech/loggo/default"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultChunkSize is the size a playback chunk is aligned to when it is not overridden
+const DefaultChunkSize = 10 * 1024 * 1024 // 10 MiB
+
+// sequentialPrefetchChunks is how many chunks are fetched ahead once sequential access is detected
+const sequentialPrefetchChunks = 2
+
+// chunkKey identifies a single aligned chunk of an object
+type chunkKey struct {
+	ObjectID string
+	Index    int64
+}
+
+// driveOpener opens an HTTP range stream for object starting at offset. *Drive satisfies
+// this; ChunkManager and StreamPool depend on the interface rather than *Drive directly so
+// the Drive API fetch can be swapped for a fake in tests.
+type driveOpener interface {
+	Open(ctx context.Context, object *APIObject, offset int64) (io.ReadCloser, error)
+}
+
+// ChunkManager serves fixed-size, aligned chunks of Drive objects. Chunks are
+// served out of an in-memory LRU first, then a bounded, disk-backed LRU
+// store, falling back to the Drive API on a full miss. Concurrent misses for
+// the same chunk are collapsed into a single API fetch via group.
+type ChunkManager struct {
+	client    driveOpener
+	chunkSize int64
+	memory    *memChunkCache
+	disk      *diskChunkCache
+	group     singleflight.Group
+	pool      *StreamPool
+}
+
+// NewChunkManager creates a new chunk manager backed by basePath, keeping at most
+// maxMemoryChunks decoded chunks in memory and maxDiskBytes bytes on disk. API fetches
+// are served through a StreamPool that keeps at most streamsPerObject streams open per
+// object and maxStreams streams open in total, aborting any single read that exceeds
+// readTimeout.
+func NewChunkManager(client driveOpener, basePath string, chunkSize int64, maxMemoryChunks int, maxDiskBytes int64, streamsPerObject, maxStreams int, readTimeout time.Duration) (*ChunkManager, error) {
+	disk, err := newDiskChunkCache(basePath, maxDiskBytes)
+	if nil != err {
+		return nil, err
+	}
+
+	return &ChunkManager{
+		client:    client,
+		chunkSize: chunkSize,
+		memory:    newMemChunkCache(maxMemoryChunks),
+		disk:      disk,
+		pool:      NewStreamPool(client, streamsPerObject, maxStreams, readTimeout),
+	}, nil
+}
+
+// chunkIndex returns the index of the chunk that contains offset
+func (m *ChunkManager) chunkIndex(offset int64) int64 {
+	return offset / m.chunkSize
+}
+
+// chunkOffset returns the byte offset at which the chunk at index starts
+func (m *ChunkManager) chunkOffset(index int64) int64 {
+	return index * m.chunkSize
+}
+
+// GetChunk returns the bytes of the chunk at index for object, loading it from disk
+// or the Drive API if it is not already cached in memory. Concurrent calls for the
+// same chunk share a single underlying fetch. ctx bounds only the API fetch; a cache
+// hit always returns immediately.
+func (m *ChunkManager) GetChunk(ctx context.Context, object *APIObject, index int64) ([]byte, error) {
+	key := chunkKey{ObjectID: object.ObjectID, Index: index}
+
+	if bytes, ok := m.memory.Get(key); ok {
+		Log.Tracef("Found chunk %v:%v in memory", key.ObjectID, key.Index)
+		return bytes, nil
+	}
+
+	if bytes, ok := m.disk.Get(key, object.LastModified); ok {
+		Log.Tracef("Found chunk %v:%v on disk", key.ObjectID, key.Index)
+		m.memory.Put(key, bytes)
+		return bytes, nil
+	}
+
+	groupKey := fmt.Sprintf("%v:%v", key.ObjectID, key.Index)
+	value, err, _ := m.group.Do(groupKey, func() (interface{}, error) {
+		// a concurrent waiter may have populated the caches while we were queued
+		if bytes, ok := m.memory.Get(key); ok {
+			return bytes, nil
+		}
+		if bytes, ok := m.disk.Get(key, object.LastModified); ok {
+			m.memory.Put(key, bytes)
+			return bytes, nil
+		}
+
+		Log.Debugf("Loading chunk %v:%v from API", key.ObjectID, key.Index)
+		bytes, err := m.loadFromAPI(ctx, object, index)
+		if nil != err {
+			return nil, err
+		}
+
+		m.memory.Put(key, bytes)
+		m.disk.Put(key, bytes, object.LastModified)
+
+		return bytes, nil
+	})
+	if nil != err {
+		return nil, err
+	}
+
+	return value.([]byte), nil
+}
+
+func (m *ChunkManager) loadFromAPI(ctx context.Context, object *APIObject, index int64) ([]byte, error) {
+	offset := m.chunkOffset(index)
+	if uint64(offset) >= object.Size {
+		return nil, io.EOF
+	}
+
+	size := m.chunkSize
+	if uint64(offset+size) > object.Size {
+		size = int64(object.Size) - offset
+	}
+
+	bytes, err := m.pool.Read(ctx, object, offset, size)
+	if nil != err {
+		return nil, fmt.Errorf("Could not read chunk %v of %v (%v)", index, object.ObjectID, err)
+	}
+
+	return bytes, nil
+}
+
+// Prefetch eagerly loads up to count chunks starting at startIndex, stopping at EOF.
+// It is meant to be called from a background goroutine once sequential access is detected,
+// so it carries its own context rather than the triggering request's.
+func (m *ChunkManager) Prefetch(object *APIObject, startIndex int64, count int) {
+	ctx := context.Background()
+
+	for i := 0; i < count; i++ {
+		index := startIndex + int64(i)
+		if uint64(m.chunkOffset(index)) >= object.Size {
+			return
+		}
+
+		key := chunkKey{ObjectID: object.ObjectID, Index: index}
+		if _, ok := m.memory.Get(key); ok {
+			continue
+		}
+		if _, ok := m.disk.Get(key, object.LastModified); ok {
+			continue
+		}
+
+		Log.Tracef("Prefetching chunk %v:%v", key.ObjectID, key.Index)
+		if _, err := m.GetChunk(ctx, object, index); nil != err {
+			Log.Debugf("Prefetch of chunk %v:%v failed (%v)", key.ObjectID, key.Index, err)
+			return
+		}
+	}
+}
+
+// EvictObject drops every cached chunk of objectID from both cache tiers. It should be called
+// from the change-feed handler as soon as that object is reported changed or deleted, so a
+// chunk cached from the old content is never served after the object was overwritten.
+func (m *ChunkManager) EvictObject(objectID string) {
+	m.memory.EvictObject(objectID)
+	m.disk.EvictObject(objectID)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingDriveOpener counts calls to Open and blocks each one on release, so a test can hold
+// every concurrent caller back until they've all queued up behind a single in-flight fetch.
+type countingDriveOpener struct {
+	data    []byte
+	release chan struct{}
+
+	mu    sync.Mutex
+	opens int
+}
+
+func (f *countingDriveOpener) Open(ctx context.Context, object *APIObject, offset int64) (io.ReadCloser, error) {
+	f.mu.Lock()
+	f.opens++
+	f.mu.Unlock()
+
+	<-f.release
+
+	return ioutil.NopCloser(bytes.NewReader(f.data[offset:])), nil
+}
+
+func TestChunkManagerGetChunkDedupsConcurrentMisses(t *testing.T) {
+	data := make([]byte, 1024)
+	opener := &countingDriveOpener{data: data, release: make(chan struct{})}
+
+	chunks, err := NewChunkManager(opener, t.TempDir(), 1024, 8, 1<<20, 4, 16, time.Second)
+	if nil != err {
+		t.Fatalf("NewChunkManager() error = %v", err)
+	}
+
+	object := &APIObject{ObjectID: "obj", Size: uint64(len(data))}
+
+	const concurrency = 20
+	start := make(chan struct{})
+	errs := make(chan error, concurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := chunks.GetChunk(context.Background(), object, 0)
+			errs <- err
+		}()
+	}
+
+	close(start)
+	time.Sleep(20 * time.Millisecond) // give every goroutine a chance to queue up behind the one in-flight fetch
+	close(opener.release)
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if nil != err {
+			t.Fatalf("GetChunk() error = %v", err)
+		}
+	}
+
+	opener.mu.Lock()
+	defer opener.mu.Unlock()
+	if 1 != opener.opens {
+		t.Fatalf("client.Open called %v times, want 1 (concurrent misses for the same chunk should collapse into a single fetch)", opener.opens)
+	}
+}
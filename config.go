@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"time"
+)
+
+// Config holds the CLI-configurable cache, chunk and stream settings. It is parsed once at
+// startup and used to open the Cache and ChunkManager that the rest of plexdrive runs on.
+type Config struct {
+	CacheURL      string
+	CacheUser     string
+	CachePass     string
+	CacheDatabase string
+	CacheBasePath string
+	SQLDebug      bool
+
+	ChunkSize        int64
+	MaxMemoryChunks  int
+	MaxDiskBytes     int64
+	StreamsPerObject int
+	MaxStreams       int
+	ReadTimeout      time.Duration
+}
+
+// ParseFlags parses args into a Config, defaulting to an embedded BoltDB cache so plexdrive
+// runs without any external service unless --cache-url points at one.
+func ParseFlags(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("plexdrive", flag.ContinueOnError)
+
+	config := &Config{}
+	fs.StringVar(&config.CacheURL, "cache-url", "bolt://", "Cache backend URL (mongodb://, redis:// or bolt://)")
+	fs.StringVar(&config.CacheUser, "cache-user", "", "Cache username, if required by the backend")
+	fs.StringVar(&config.CachePass, "cache-pass", "", "Cache password, if required by the backend")
+	fs.StringVar(&config.CacheDatabase, "cache-database", "plexdrive", "Cache database name (MongoDB only)")
+	fs.StringVar(&config.CacheBasePath, "cache-path", ".", "Base path for on-disk cache state (BoltDB file, chunk store, token)")
+	fs.BoolVar(&config.SQLDebug, "sql-debug", false, "Passed through to NewCache; no cache backend reads it, so it does not change logging")
+	fs.Int64Var(&config.ChunkSize, "chunk-size", DefaultChunkSize, "Size in bytes a playback chunk is aligned to")
+	fs.IntVar(&config.MaxMemoryChunks, "chunk-memory-count", 128, "Number of decoded chunks kept in the in-memory LRU")
+	fs.Int64Var(&config.MaxDiskBytes, "chunk-disk-size", 10*1024*1024*1024, "Maximum bytes of decoded chunks kept on disk")
+	fs.IntVar(&config.StreamsPerObject, "streams-per-object", DefaultStreamsPerObject, "Number of Drive HTTP range streams kept open per object")
+	fs.IntVar(&config.MaxStreams, "max-streams", DefaultMaxStreams, "Maximum number of Drive HTTP range streams open at once")
+	fs.DurationVar(&config.ReadTimeout, "read-timeout", DefaultReadTimeout, "Deadline for a single read against a pooled Drive stream before it is aborted and reopened")
+
+	if err := fs.Parse(args); nil != err {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// OpenCache opens the cache backend selected by config.CacheURL
+func OpenCache(config *Config) (*Cache, error) {
+	return NewCache(config.CacheURL, config.CacheUser, config.CachePass, config.CacheDatabase, config.CacheBasePath, config.SQLDebug)
+}
+
+// OpenChunkManager constructs a ChunkManager for client from config and wires it into cache,
+// so the change feed's object updates and deletes evict stale chunks (see
+// Cache.SetChunkManager).
+func OpenChunkManager(client *Drive, cache *Cache, config *Config) (*ChunkManager, error) {
+	chunks, err := NewChunkManager(client, config.CacheBasePath, config.ChunkSize, config.MaxMemoryChunks, config.MaxDiskBytes, config.StreamsPerObject, config.MaxStreams, config.ReadTimeout)
+	if nil != err {
+		return nil, err
+	}
+
+	cache.SetChunkManager(chunks)
+
+	return chunks, nil
+}
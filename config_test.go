@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFlagsDefaults(t *testing.T) {
+	config, err := ParseFlags(nil)
+	if nil != err {
+		t.Fatalf("ParseFlags() error = %v", err)
+	}
+
+	if "bolt://" != config.CacheURL {
+		t.Errorf("CacheURL = %v, want bolt:// (plexdrive should run without MongoDB by default)", config.CacheURL)
+	}
+	if "plexdrive" != config.CacheDatabase {
+		t.Errorf("CacheDatabase = %v, want plexdrive", config.CacheDatabase)
+	}
+	if DefaultReadTimeout != config.ReadTimeout {
+		t.Errorf("ReadTimeout = %v, want %v", config.ReadTimeout, DefaultReadTimeout)
+	}
+}
+
+func TestParseFlagsOverridesCacheURL(t *testing.T) {
+	config, err := ParseFlags([]string{"-cache-url", "redis://localhost:6379"})
+	if nil != err {
+		t.Fatalf("ParseFlags() error = %v", err)
+	}
+
+	if "redis://localhost:6379" != config.CacheURL {
+		t.Errorf("CacheURL = %v, want redis://localhost:6379", config.CacheURL)
+	}
+}
+
+func TestParseFlagsOverridesReadTimeout(t *testing.T) {
+	config, err := ParseFlags([]string{"-read-timeout", "5s"})
+	if nil != err {
+		t.Fatalf("ParseFlags() error = %v", err)
+	}
+
+	if 5*time.Second != config.ReadTimeout {
+		t.Errorf("ReadTimeout = %v, want 5s", config.ReadTimeout)
+	}
+}
+
+func TestOpenChunkManagerWiresCacheEviction(t *testing.T) {
+	config, err := ParseFlags([]string{"-cache-path", t.TempDir(), "-chunk-disk-size", "1048576"})
+	if nil != err {
+		t.Fatalf("ParseFlags() error = %v", err)
+	}
+
+	cache := &Cache{MetadataStore: newFakeMetadataStore()}
+
+	chunks, err := OpenChunkManager(nil, cache, config)
+	if nil != err {
+		t.Fatalf("OpenChunkManager() error = %v", err)
+	}
+
+	object := &APIObject{ObjectID: "obj"}
+	key := chunkKey{ObjectID: object.ObjectID, Index: 0}
+	chunks.memory.Put(key, []byte("stale"))
+
+	if err := cache.DeleteObject(nil, object.ObjectID); nil != err {
+		t.Fatalf("DeleteObject() error = %v", err)
+	}
+	if _, ok := chunks.memory.Get(key); ok {
+		t.Fatal("expected OpenChunkManager to wire cache eviction into the chunk manager it returned")
+	}
+}
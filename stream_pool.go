@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	. "github.com/claudetech/loggo/default"
+)
+
+// DefaultStreamsPerObject is the default number of HTTP range streams kept open per object
+const DefaultStreamsPerObject = 4
+
+// DefaultMaxStreams is the default cap on HTTP range streams open across all objects
+const DefaultMaxStreams = 16
+
+// DefaultReadTimeout is the default deadline for a single read against a pooled stream,
+// exposed to users via the --read-timeout flag
+const DefaultReadTimeout = 30 * time.Second
+
+// defaultStreamIdleTimeout is how long a pooled stream is kept open without being reused
+const defaultStreamIdleTimeout = 30 * time.Second
+
+// forwardSeekWindow is the largest forward gap between a pooled stream's offset and a
+// requested offset that is worth consuming-and-discarding rather than opening a new stream
+const forwardSeekWindow = 1 << 20 // 1 MiB
+
+// pooledStream is a single open HTTP range stream, tracked by the offset its next read returns
+type pooledStream struct {
+	stream   io.ReadCloser
+	objectID string
+	offset   int64
+	lastUsed time.Time
+}
+
+// StreamPool keeps a bounded number of open Drive HTTP range streams alive across reads of the
+// same object, so sequential reads don't pay the cost of reopening a stream for every chunk. A
+// semaphore caps the number of streams in flight across all objects to stay within Drive's quota.
+type StreamPool struct {
+	client       driveOpener
+	maxPerObject int
+	idleTimeout  time.Duration
+	readTimeout  time.Duration
+	sem          chan struct{}
+
+	mu      sync.Mutex
+	streams map[string][]*pooledStream
+}
+
+// NewStreamPool creates a pool that keeps up to maxPerObject streams open per object and up
+// to maxTotal streams open across all objects. A single read against a leased stream is
+// aborted after readTimeout elapses.
+func NewStreamPool(client driveOpener, maxPerObject, maxTotal int, readTimeout time.Duration) *StreamPool {
+	pool := &StreamPool{
+		client:       client,
+		maxPerObject: maxPerObject,
+		idleTimeout:  defaultStreamIdleTimeout,
+		readTimeout:  readTimeout,
+		sem:          make(chan struct{}, maxTotal),
+		streams:      make(map[string][]*pooledStream),
+	}
+
+	go pool.evictIdleLoop()
+
+	return pool
+}
+
+// Read fetches size bytes at offset for object, reusing a pooled stream whose offset matches
+// (or is within forwardSeekWindow bytes behind), and leases the stream back to the pool
+// afterwards instead of closing it. The read is bounded by ctx and by the pool's read timeout,
+// whichever elapses first; either cause aborts and closes the underlying stream so a stuck
+// Drive response never blocks the caller indefinitely.
+func (p *StreamPool) Read(ctx context.Context, object *APIObject, offset, size int64) ([]byte, error) {
+	stream, err := p.lease(ctx, object, offset)
+	if nil != err {
+		return nil, err
+	}
+
+	buffer := make([]byte, size)
+	n, err := p.readWithDeadline(ctx, stream, buffer)
+	if nil != err {
+		Log.Debugf("%v", err)
+		p.discardBroken(stream)
+		return nil, fmt.Errorf("Could not read %v bytes at offset %v for object %v (%v)", size, offset, object.ObjectID, err)
+	}
+
+	stream.offset = offset + int64(n)
+	p.release(stream)
+
+	return buffer[:n], nil
+}
+
+// readWithDeadline reads into buffer from stream in its own goroutine, so that a ctx
+// cancellation or the pool's read timeout can abandon the read without waiting for the
+// underlying (possibly stuck) Drive stream to return.
+func (p *StreamPool) readWithDeadline(ctx context.Context, stream *pooledStream, buffer []byte) (int, error) {
+	type result struct {
+		n   int
+		err error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		n, err := io.ReadFull(stream.stream, buffer)
+		if io.EOF == err || io.ErrUnexpectedEOF == err {
+			err = nil
+		}
+		done <- result{n, err}
+	}()
+
+	timedOut := make(chan struct{})
+	timer := time.AfterFunc(p.readTimeout, func() {
+		close(timedOut)
+	})
+	defer timer.Stop()
+
+	select {
+	case res := <-done:
+		return res.n, res.err
+	case <-timedOut:
+		stream.stream.Close()
+		return 0, fmt.Errorf("read timed out after %v", p.readTimeout)
+	case <-ctx.Done():
+		stream.stream.Close()
+		return 0, ctx.Err()
+	}
+}
+
+// takePooled removes and returns a pooled stream for objectID whose offset matches offset
+// exactly or is within forwardSeekWindow bytes behind it, or nil if none is available. It
+// only touches p.streams under lock, never the stream itself, so callers are free to do
+// I/O on the returned stream after takePooled has already unlocked p.mu.
+func (p *StreamPool) takePooled(objectID string, offset int64) *pooledStream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pooled := p.streams[objectID]
+	for i, s := range pooled {
+		if s.offset == offset || (offset > s.offset && offset-s.offset <= forwardSeekWindow) {
+			p.streams[objectID] = append(pooled[:i], pooled[i+1:]...)
+			return s
+		}
+	}
+	return nil
+}
+
+func (p *StreamPool) lease(ctx context.Context, object *APIObject, offset int64) (*pooledStream, error) {
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+
+	if match := p.takePooled(object.ObjectID, offset); nil != match {
+		if offset > match.offset {
+			if _, err := io.CopyN(ioutil.Discard, match.stream, offset-match.offset); nil != err {
+				p.discardBroken(match)
+			} else {
+				match.offset = offset
+				return match, nil
+			}
+		} else {
+			return match, nil
+		}
+	}
+
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	Log.Debugf("Opening new pooled stream for %v at offset %v", object.ObjectID, offset)
+	stream, err := p.client.Open(ctx, object, offset)
+	if nil != err {
+		<-p.sem
+		Log.Debugf("%v", err)
+		return nil, fmt.Errorf("Could not open stream for object %v at offset %v", object.ObjectID, offset)
+	}
+
+	return &pooledStream{
+		stream:   stream,
+		objectID: object.ObjectID,
+		offset:   offset,
+	}, nil
+}
+
+// release returns a stream to the pool, closing it instead if the object's slot is full
+func (p *StreamPool) release(s *pooledStream) {
+	s.lastUsed = time.Now()
+
+	p.mu.Lock()
+	pooled := p.streams[s.objectID]
+	if len(pooled) >= p.maxPerObject {
+		p.mu.Unlock()
+		p.discardBroken(s)
+		return
+	}
+	p.streams[s.objectID] = append(pooled, s)
+	p.mu.Unlock()
+}
+
+// discardBroken closes a stream that can no longer be reused and frees its semaphore slot
+func (p *StreamPool) discardBroken(s *pooledStream) {
+	if err := s.stream.Close(); nil != err {
+		Log.Debugf("%v", err)
+	}
+	<-p.sem
+}
+
+func (p *StreamPool) evictIdleLoop() {
+	ticker := time.NewTicker(p.idleTimeout)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		p.evictIdle()
+	}
+}
+
+func (p *StreamPool) evictIdle() {
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for objectID, pooled := range p.streams {
+		kept := pooled[:0]
+		for _, s := range pooled {
+			if now.Sub(s.lastUsed) >= p.idleTimeout {
+				Log.Tracef("Evicting idle stream for %v at offset %v", s.objectID, s.offset)
+				s.stream.Close()
+				<-p.sem
+				continue
+			}
+			kept = append(kept, s)
+		}
+		if 0 == len(kept) {
+			delete(p.streams, objectID)
+		} else {
+			p.streams[objectID] = kept
+		}
+	}
+}
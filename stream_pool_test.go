@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+// failingReader errors on every Read, simulating a stream that breaks mid-discard.
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) { return 0, errors.New("broken stream") }
+func (failingReader) Close() error               { return nil }
+
+func newTestStreamPool() *StreamPool {
+	return &StreamPool{
+		maxPerObject: 4,
+		sem:          make(chan struct{}, 4),
+		streams:      make(map[string][]*pooledStream),
+	}
+}
+
+func TestStreamPoolTakePooled(t *testing.T) {
+	tests := []struct {
+		name       string
+		poolOffset int64
+		offset     int64
+		wantMatch  bool
+	}{
+		{"exact offset match", 100, 100, true},
+		{"within forward seek window", 100, 100 + forwardSeekWindow, true},
+		{"beyond forward seek window", 100, 100 + forwardSeekWindow + 1, false},
+		{"offset before pooled stream", 100, 50, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestStreamPool()
+			s := &pooledStream{stream: failingReader{}, objectID: "obj", offset: tt.poolOffset}
+			p.streams["obj"] = []*pooledStream{s}
+
+			match := p.takePooled("obj", tt.offset)
+			if tt.wantMatch != (nil != match) {
+				t.Fatalf("takePooled() match = %v, want %v", nil != match, tt.wantMatch)
+			}
+			if tt.wantMatch && len(p.streams["obj"]) != 0 {
+				t.Fatalf("expected matched stream to be removed from the pool, got %v left", len(p.streams["obj"]))
+			}
+			if !tt.wantMatch && len(p.streams["obj"]) != 1 {
+				t.Fatalf("expected unmatched stream to remain in the pool")
+			}
+		})
+	}
+}
+
+// TestStreamPoolLeaseDiscardFailureDoesNotDoubleUnlock reproduces the sequence lease() runs
+// when a forward-seek reuse is discarded and the discard I/O fails: takePooled unlocks p.mu
+// as soon as it has removed the match, so the failed discard read (lease() uses CopyN, the
+// ReadAll below stands in for it) and discardBroken() must
+// not touch p.mu again. Before the fix, lease() unlocked p.mu itself right after removing the
+// match and then fell through to a second, unconditional Unlock() on the same code path,
+// which panics with "sync: unlock of unlocked mutex".
+func TestStreamPoolLeaseDiscardFailureDoesNotDoubleUnlock(t *testing.T) {
+	p := newTestStreamPool()
+	broken := &pooledStream{stream: failingReader{}, objectID: "obj", offset: 0}
+	p.streams["obj"] = []*pooledStream{broken}
+	p.sem <- struct{}{}
+
+	match := p.takePooled("obj", 10)
+	if nil == match {
+		t.Fatal("expected to find the pooled stream")
+	}
+
+	if _, err := ioutil.ReadAll(match.stream); nil == err {
+		t.Fatal("expected the forced read error")
+	}
+
+	p.discardBroken(match)
+
+	// A mutex that was already unlocked by takePooled must still be lockable exactly once.
+	p.mu.Lock()
+	p.mu.Unlock()
+}